@@ -0,0 +1,149 @@
+// Package ratelimit provides a Discord-aware, per-route token bucket for
+// scan-style REST calls (paginating channel history, bulk audits, etc.)
+// that would otherwise have to guess at fixed sleeps between requests.
+package ratelimit
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	minBackoff    = 1 * time.Second
+	maxBackoff    = 60 * time.Second
+	backoffFactor = 2.0
+	jitterPct     = 0.2
+)
+
+// tokenBucket mirrors a single Discord rate-limit bucket, as identified by
+// the `X-RateLimit-Bucket` header. Until a response labels it, callers key
+// it by route instead.
+type tokenBucket struct {
+	mu        sync.Mutex
+	remaining int
+	hasInfo   bool
+	resetAt   time.Time
+}
+
+// update records the remaining calls and when they reset, as reported by
+// the most recent response for this bucket.
+func (b *tokenBucket) update(remaining int, resetAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remaining = remaining
+	b.resetAt = time.Now().Add(resetAfter)
+	b.hasInfo = true
+}
+
+// wait blocks until the bucket has at least one call remaining.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.hasInfo || b.remaining > 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	until := b.resetAt
+	b.mu.Unlock()
+
+	d := time.Until(until)
+	if d <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Limiter tracks one tokenBucket per resolved Discord rate-limit bucket (or
+// per route, until its bucket ID is learned), plus a single global switch
+// that pauses every bucket when Discord signals `X-RateLimit-Global`.
+type Limiter struct {
+	buckets        sync.Map // key: route or bucket ID -> *tokenBucket
+	routeBucketIDs sync.Map // key: route -> resolved bucket ID
+	globalReset    atomic.Int64
+}
+
+// NewLimiter returns an empty Limiter ready for use.
+func NewLimiter() *Limiter {
+	return &Limiter{}
+}
+
+// Default is the process-wide limiter shared by scan callers that don't need
+// isolated rate-limit state of their own.
+var Default = NewLimiter()
+
+func (l *Limiter) bucketFor(key string) *tokenBucket {
+	v, _ := l.buckets.LoadOrStore(key, &tokenBucket{})
+	return v.(*tokenBucket)
+}
+
+// bucketForRoute returns the bucket currently associated with route, which
+// is the route itself until a response resolves it to a real bucket ID.
+func (l *Limiter) bucketForRoute(route string) *tokenBucket {
+	if v, ok := l.routeBucketIDs.Load(route); ok {
+		return l.bucketFor(v.(string))
+	}
+	return l.bucketFor(route)
+}
+
+// learnBucketID associates route with the bucket ID Discord reported for it,
+// so future calls on the route share state with anything else on that
+// bucket.
+func (l *Limiter) learnBucketID(route, bucketID string) *tokenBucket {
+	if bucketID == "" {
+		return l.bucketForRoute(route)
+	}
+	l.routeBucketIDs.Store(route, bucketID)
+	return l.bucketFor(bucketID)
+}
+
+// waitGlobal blocks while Discord's global rate limit is in effect.
+func (l *Limiter) waitGlobal(ctx context.Context) error {
+	for {
+		until := l.globalReset.Load()
+		if until == 0 || time.Now().UnixNano() >= until {
+			return nil
+		}
+
+		select {
+		case <-time.After(time.Duration(until - time.Now().UnixNano())):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// setGlobal pauses every bucket for d.
+func (l *Limiter) setGlobal(d time.Duration) {
+	l.globalReset.Store(time.Now().Add(d).UnixNano())
+}
+
+// nextBackoff doubles d (capped at maxBackoff) and applies ±jitterPct jitter.
+func nextBackoff(d time.Duration) time.Duration {
+	d = time.Duration(float64(d) * backoffFactor)
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return jitter(d)
+}
+
+func jitter(d time.Duration) time.Duration {
+	delta := float64(d) * jitterPct
+	return d + time.Duration((rand.Float64()*2-1)*delta)
+}
+
+func parseRetryAfterSeconds(s string) time.Duration {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f <= 0 {
+		return minBackoff
+	}
+	return time.Duration(f * float64(time.Second))
+}
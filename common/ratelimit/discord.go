@@ -0,0 +1,213 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+// maxAttempts bounds how many times a single call retries after a 429
+// before giving up and surfacing the error to the caller.
+const maxAttempts = 8
+
+// ChannelMessages is a rate-limit-aware replacement for
+// common.BotSession.ChannelMessages, meant for scan-style callers (history
+// reprocessing, audits, ...) that page through a lot of history and can't
+// afford a fixed sleep between every batch. It blocks on the resolved
+// per-route bucket when Discord reports no calls remaining, and retries
+// 429s with jittered exponential backoff honoring `Retry-After`.
+func (l *Limiter) ChannelMessages(ctx context.Context, session *discordgo.Session, channelID int64, limit int, beforeID, afterID, aroundID int64) ([]*discordgo.Message, error) {
+	route := fmt.Sprintf("GET /channels/%d/messages", channelID)
+	backoff := minBackoff
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if err := l.waitGlobal(ctx); err != nil {
+			return nil, err
+		}
+
+		bucket := l.bucketForRoute(route)
+		if err := bucket.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		messages, retryAfter, global, err := l.doChannelMessages(ctx, session, route, channelID, limit, beforeID, afterID, aroundID)
+		if err != nil {
+			return nil, err
+		}
+
+		if retryAfter == 0 {
+			return messages, nil
+		}
+
+		if global {
+			l.setGlobal(retryAfter)
+		}
+
+		if retryAfter > backoff {
+			backoff = retryAfter
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff = nextBackoff(backoff)
+	}
+
+	return nil, fmt.Errorf("rate limited fetching channel %d messages after %d attempts", channelID, maxAttempts)
+}
+
+// doChannelMessages issues a single request. A non-zero retryAfter means the
+// caller hit a 429 and should back off and retry; any other error is fatal.
+func (l *Limiter) doChannelMessages(ctx context.Context, session *discordgo.Session, route string, channelID int64, limit int, beforeID, afterID, aroundID int64) (messages []*discordgo.Message, retryAfter time.Duration, global bool, err error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if beforeID != 0 {
+		q.Set("before", strconv.FormatInt(beforeID, 10))
+	}
+	if afterID != 0 {
+		q.Set("after", strconv.FormatInt(afterID, 10))
+	}
+	if aroundID != 0 {
+		q.Set("around", strconv.FormatInt(aroundID, 10))
+	}
+
+	reqURL := fmt.Sprintf("%s/channels/%d/messages?%s", discordgo.EndpointAPI, channelID, q.Encode())
+	body, retryAfter, global, err := l.do(ctx, session, route, reqURL)
+	if err != nil || retryAfter != 0 {
+		return nil, retryAfter, global, err
+	}
+	if err := json.Unmarshal(body, &messages); err != nil {
+		return nil, 0, false, err
+	}
+	return messages, 0, false, nil
+}
+
+// MessageReactions is a rate-limit-aware replacement for
+// common.BotSession.MessageReactions, used by the per-guild reaction
+// detection rules (see applyReactionRules) so fetching a reactor list for a
+// busy channel plays by the same bucket/backoff rules as ChannelMessages
+// instead of firing unthrottled.
+func (l *Limiter) MessageReactions(ctx context.Context, session *discordgo.Session, channelID, messageID int64, emojiID string, limit int, beforeID, afterID int64) ([]*discordgo.User, error) {
+	// Keyed on channelID alone, not (channelID, messageID, emojiID): the
+	// channel is the route's actual major param, so every message's and
+	// every emoji's reactions in a channel share one bucket, same as
+	// ChannelMessages. Keying on the message (or emoji) gave every fetch its
+	// own brand-new, empty bucket - bucket.wait never had anything to throttle
+	// on, so this fell back to reactive 429 backoff only, same as having no
+	// rate limiting at all.
+	route := fmt.Sprintf("GET /channels/%d/messages/*/reactions", channelID)
+	backoff := minBackoff
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if err := l.waitGlobal(ctx); err != nil {
+			return nil, err
+		}
+
+		bucket := l.bucketForRoute(route)
+		if err := bucket.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		users, retryAfter, global, err := l.doMessageReactions(ctx, session, route, channelID, messageID, emojiID, limit, beforeID, afterID)
+		if err != nil {
+			return nil, err
+		}
+
+		if retryAfter == 0 {
+			return users, nil
+		}
+
+		if global {
+			l.setGlobal(retryAfter)
+		}
+
+		if retryAfter > backoff {
+			backoff = retryAfter
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff = nextBackoff(backoff)
+	}
+
+	return nil, fmt.Errorf("rate limited fetching reactions for message %d after %d attempts", messageID, maxAttempts)
+}
+
+func (l *Limiter) doMessageReactions(ctx context.Context, session *discordgo.Session, route string, channelID, messageID int64, emojiID string, limit int, beforeID, afterID int64) (users []*discordgo.User, retryAfter time.Duration, global bool, err error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if beforeID != 0 {
+		q.Set("before", strconv.FormatInt(beforeID, 10))
+	}
+	if afterID != 0 {
+		q.Set("after", strconv.FormatInt(afterID, 10))
+	}
+
+	reqURL := fmt.Sprintf("%s/channels/%d/messages/%d/reactions/%s?%s", discordgo.EndpointAPI, channelID, messageID, url.PathEscape(emojiID), q.Encode())
+	body, retryAfter, global, err := l.do(ctx, session, route, reqURL)
+	if err != nil || retryAfter != 0 {
+		return nil, retryAfter, global, err
+	}
+	if err := json.Unmarshal(body, &users); err != nil {
+		return nil, 0, false, err
+	}
+	return users, 0, false, nil
+}
+
+// do issues a single GET, authenticated and transported through the same
+// session.Client, session.Token and session.UserAgent that
+// common.BotSession's own request methods use, rather than a second HTTP
+// client with its own idea of how to authenticate - this package only adds
+// the proactive bucket wait/backoff around the call, not a parallel
+// implementation of the request itself. A non-zero retryAfter means the
+// caller hit a 429 and should back off and retry; any other error is fatal.
+func (l *Limiter) do(ctx context.Context, session *discordgo.Session, route, reqURL string) (body []byte, retryAfter time.Duration, global bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	req.Header.Set("Authorization", session.Token)
+	req.Header.Set("User-Agent", session.UserAgent)
+
+	resp, err := session.Client.Do(req)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer resp.Body.Close()
+
+	bucket := l.learnBucketID(route, resp.Header.Get("X-RateLimit-Bucket"))
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		bucket.update(remaining, parseRetryAfterSeconds(resp.Header.Get("X-RateLimit-Reset-After")))
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter = parseRetryAfterSeconds(resp.Header.Get("Retry-After"))
+		global = resp.Header.Get("X-RateLimit-Global") == "true"
+		return nil, retryAfter, global, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, false, fmt.Errorf("discord returned HTTP %d for %s", resp.StatusCode, route)
+	}
+
+	return body, 0, false, nil
+}
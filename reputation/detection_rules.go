@@ -0,0 +1,251 @@
+package reputation
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/ratelimit"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/reputation/models"
+)
+
+// compiledRule is a DetectionRule with its pattern pre-compiled, so scanning
+// a channel doesn't recompile every guild's regexes for every message.
+type compiledRule struct {
+	kind           models.DetectionRuleKind
+	regex          *regexp.Regexp
+	keyword        string
+	emoji          string
+	requireMention bool
+	weight         int
+	// key distinguishes this rule from every other rule of the same kind in
+	// the source column recorded by creditDetectionWeighted/recordDetection.
+	// Without it, two rules of the same kind matching the same message (e.g.
+	// keyword rules for "gracias" and "merci" both present) would record the
+	// same source, and reputation_processed_messages' unique index on
+	// (guild_id, message_id, source) would insert-or-ignore the second one,
+	// silently dropping its weight.
+	key string
+}
+
+// ruleKey derives a stable identifier for a rule from its own content, so it
+// stays the same across a reload even if rules are reordered - an index
+// into conf.DetectionRules wouldn't.
+func ruleKey(rule models.DetectionRule) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s|%s|%s|%t", rule.Kind, rule.Pattern, rule.Emoji, rule.RequireMention)
+	return fmt.Sprintf("%x", h.Sum32())
+}
+
+type compiledRuleSet struct {
+	version  int
+	regex    []compiledRule
+	keyword  []compiledRule
+	reaction []compiledRule
+}
+
+var (
+	ruleCacheMu sync.RWMutex
+	ruleCache   = make(map[int64]*compiledRuleSet)
+)
+
+// compiledRulesFor returns the compiled DetectionRules for a guild, rebuilding
+// the cache entry whenever conf.ConfigVersion has moved on (e.g. after the
+// control panel saves new rules).
+func compiledRulesFor(guildID int64, conf *models.ReputationConfig) *compiledRuleSet {
+	ruleCacheMu.RLock()
+	cached, ok := ruleCache[guildID]
+	ruleCacheMu.RUnlock()
+	if ok && cached.version == conf.ConfigVersion {
+		return cached
+	}
+
+	set := &compiledRuleSet{version: conf.ConfigVersion}
+	for _, rule := range conf.DetectionRules {
+		cr := compiledRule{
+			kind:           rule.Kind,
+			requireMention: rule.RequireMention,
+			weight:         rule.Weight,
+			key:            ruleKey(rule),
+		}
+		if cr.weight == 0 {
+			cr.weight = 1
+		}
+
+		switch rule.Kind {
+		case models.DetectionRuleKindRegex:
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				logger.WithError(err).Errorf("Skipping invalid rep detection regex for guild %d: %q", guildID, rule.Pattern)
+				continue
+			}
+			cr.regex = re
+			set.regex = append(set.regex, cr)
+		case models.DetectionRuleKindKeyword:
+			cr.keyword = strings.ToLower(rule.Pattern)
+			set.keyword = append(set.keyword, cr)
+		case models.DetectionRuleKindReaction:
+			cr.emoji = rule.Emoji
+			set.reaction = append(set.reaction, cr)
+		}
+	}
+
+	ruleCacheMu.Lock()
+	ruleCache[guildID] = set
+	ruleCacheMu.Unlock()
+	return set
+}
+
+// applyTextRules runs a message through the guild's configured regex and
+// keyword rules, crediting the first mentioned user for each rule that
+// matches. A message with no mention credits nobody, whether or not the
+// rule sets requireMention.
+func applyTextRules(ctx context.Context, guildID int64, msg *discordgo.Message, rules *compiledRuleSet, conf *models.ReputationConfig, repChanges map[int64]int64) error {
+	cooldown := time.Duration(conf.Cooldown) * time.Second
+
+	mentionedID := int64(0)
+	if len(msg.Mentions) > 0 {
+		mentionedID = msg.Mentions[0].ID
+	}
+
+	for _, rule := range rules.regex {
+		if rule.requireMention && mentionedID == 0 {
+			continue
+		}
+		if !rule.regex.MatchString(msg.Content) {
+			continue
+		}
+		if err := creditRuleMatch(ctx, guildID, msg, mentionedID, rule, cooldown, repChanges); err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range rules.keyword {
+		if rule.requireMention && mentionedID == 0 {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(msg.Content), rule.keyword) {
+			continue
+		}
+		if err := creditRuleMatch(ctx, guildID, msg, mentionedID, rule, cooldown, repChanges); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func creditRuleMatch(ctx context.Context, guildID int64, msg *discordgo.Message, receiverID int64, rule compiledRule, cooldown time.Duration, repChanges map[int64]int64) error {
+	if receiverID == 0 || receiverID == msg.Author.ID {
+		return nil
+	}
+	source := fmt.Sprintf("rule:%s:%s", rule.kind, rule.key)
+	return creditDetectionWeighted(ctx, guildID, msg, msg.Author.ID, receiverID, source, rule.weight, cooldown, repChanges)
+}
+
+// InvalidateDetectionRuleCache drops a guild's compiled rule cache entry.
+// Called by SaveDetectionRules after it bumps ReputationConfig.ConfigVersion,
+// so the next reprocess scan picks up the new rules instead of the stale
+// compiled ones.
+func InvalidateDetectionRuleCache(guildID int64) {
+	ruleCacheMu.Lock()
+	delete(ruleCache, guildID)
+	ruleCacheMu.Unlock()
+}
+
+// SaveDetectionRules validates and persists a guild's detection rules, then
+// invalidates the compiled cache so the next reprocess scan picks up the
+// change (live messages are not checked against these rules). It's the
+// single entry point for both the control panel's save
+// handler (see HandleSaveDetectionRules) and anything else that needs to
+// change a guild's rules programmatically.
+func SaveDetectionRules(ctx context.Context, guildID int64, rules models.DetectionRules) error {
+	if err := ValidateDetectionRules(rules); err != nil {
+		return err
+	}
+
+	_, err := common.PQ.ExecContext(ctx, `UPDATE reputation_configs
+		SET detection_rules = $2, config_version = config_version + 1, updated_at = NOW()
+		WHERE guild_id = $1`, guildID, rules)
+	if err != nil {
+		return err
+	}
+
+	InvalidateDetectionRuleCache(guildID)
+	return nil
+}
+
+// ValidateDetectionRules is used by the control panel form handler to reject
+// a rule set before it's saved, rather than discovering a bad regex or an
+// unknown Kind the next time a channel is scanned.
+func ValidateDetectionRules(rules models.DetectionRules) error {
+	for i, rule := range rules {
+		switch rule.Kind {
+		case models.DetectionRuleKindRegex:
+			if rule.Pattern == "" {
+				return fmt.Errorf("rule %d: regex rules require a pattern", i)
+			}
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("rule %d: invalid regex: %w", i, err)
+			}
+		case models.DetectionRuleKindKeyword:
+			if rule.Pattern == "" {
+				return fmt.Errorf("rule %d: keyword rules require a pattern", i)
+			}
+		case models.DetectionRuleKindReaction:
+			if rule.Emoji == "" {
+				return fmt.Errorf("rule %d: reaction rules require an emoji", i)
+			}
+		default:
+			return fmt.Errorf("rule %d: unknown kind %q", i, rule.Kind)
+		}
+	}
+	return nil
+}
+
+// applyReactionRules checks a message's reaction summary against the guild's
+// configured reactor emoji, fetching the reactor list (and crediting the
+// message author once per qualifying reactor) only for emoji that are
+// actually present, to avoid an extra API call per message.
+func applyReactionRules(ctx context.Context, guildID, channelID int64, msg *discordgo.Message, rules *compiledRuleSet, conf *models.ReputationConfig, repChanges map[int64]int64) error {
+	if len(rules.reaction) == 0 || len(msg.Reactions) == 0 {
+		return nil
+	}
+	cooldown := time.Duration(conf.Cooldown) * time.Second
+
+	for _, rule := range rules.reaction {
+		present := false
+		for _, r := range msg.Reactions {
+			if r.Emoji.APIName() == rule.emoji {
+				present = true
+				break
+			}
+		}
+		if !present {
+			continue
+		}
+
+		reactors, err := ratelimit.Default.MessageReactions(ctx, common.BotSession, channelID, msg.ID, rule.emoji, 100, 0, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, reactor := range reactors {
+			if reactor.ID == 0 || reactor.ID == msg.Author.ID {
+				continue
+			}
+			source := fmt.Sprintf("rule:reaction:%s:%s:%d", rule.emoji, rule.key, reactor.ID)
+			if err := creditDetectionWeighted(ctx, guildID, msg, reactor.ID, msg.Author.ID, source, rule.weight, cooldown, repChanges); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package models
+
+// ReputationConfig is a guild's reputation plugin settings, backed by the
+// reputation_configs table. DetectionRules and ConfigVersion were added
+// alongside the configurable detection rules feature (see
+// reputation/detection_rules.go); ConfigVersion is bumped on every save so
+// compiledRulesFor knows when a guild's cached rules are stale.
+type ReputationConfig struct {
+	GuildID                int64
+	Cooldown               int
+	DisableThanksDetection bool
+	DetectionRules         DetectionRules
+	ConfigVersion          int
+}
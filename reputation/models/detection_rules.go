@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// DetectionRuleKind identifies how a DetectionRule recognizes a
+// rep-worthy message.
+type DetectionRuleKind string
+
+const (
+	// DetectionRuleKindRegex matches Pattern against the message content,
+	// crediting the first mentioned user. A matching message with no
+	// mention credits nobody, whatever RequireMention is set to.
+	DetectionRuleKindRegex DetectionRuleKind = "regex"
+	// DetectionRuleKindReaction credits the message author when another
+	// user reacts with Emoji.
+	DetectionRuleKindReaction DetectionRuleKind = "reaction"
+	// DetectionRuleKindKeyword is a simpler case-insensitive substring
+	// match against Pattern, for servers whose "thanks" word isn't English.
+	DetectionRuleKindKeyword DetectionRuleKind = "keyword"
+)
+
+// DetectionRule is one configurable way a guild can trigger reputation,
+// stored as an element of ReputationConfig.DetectionRules.
+type DetectionRule struct {
+	Kind           DetectionRuleKind `json:"kind"`
+	Pattern        string            `json:"pattern,omitempty"`
+	Emoji          string            `json:"emoji,omitempty"`
+	RequireMention bool              `json:"require_mention"`
+	Weight         int               `json:"weight"`
+}
+
+// DetectionRules is the JSONB-backed column type for
+// ReputationConfig.DetectionRules, letting servers add their own regexes,
+// reaction emoji, or localized keywords without a code change.
+type DetectionRules []DetectionRule
+
+// Value implements driver.Valuer.
+func (d DetectionRules) Value() (driver.Value, error) {
+	if d == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(d)
+}
+
+// Scan implements sql.Scanner.
+func (d *DetectionRules) Scan(src interface{}) error {
+	if src == nil {
+		*d = nil
+		return nil
+	}
+
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("models: cannot scan %T into DetectionRules", src)
+	}
+
+	if len(b) == 0 {
+		*d = nil
+		return nil
+	}
+	return json.Unmarshal(b, d)
+}
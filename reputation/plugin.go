@@ -0,0 +1,35 @@
+// Package reputation implements the !giverep/thanks-detection reputation
+// system, including per-guild cooldowns, configurable detection rules (see
+// detection_rules.go) and background reprocessing of message history (see
+// reprocess.go).
+package reputation
+
+import (
+	"context"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+var logger = common.GetPluginLogger(&Plugin{})
+
+type Plugin struct{}
+
+func RegisterPlugin() {
+	p := &Plugin{}
+	common.RegisterPlugin(p)
+}
+
+func (p *Plugin) PluginInfo() *common.PluginInfo {
+	return &common.PluginInfo{
+		Name:     "Reputation",
+		SysName:  "reputation",
+		Category: common.PluginCategoryFun,
+	}
+}
+
+// BotInit resumes any reprocess job a guild had running when the bot last
+// stopped, so an interrupted -reprocessrep scan doesn't just sit at
+// done=false forever until someone notices and runs -resume by hand.
+func (p *Plugin) BotInit() {
+	ResumeIncompleteReprocessJobs(context.Background())
+}
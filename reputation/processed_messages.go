@@ -0,0 +1,157 @@
+package reputation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/reputation/models"
+)
+
+// querier is satisfied by both common.PQ and a *sql.Tx, so withinGiveWindow
+// and recordDetection can run standalone or inside the advisory-lock-guarded
+// transaction creditDetectionWeighted uses.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Detection sources recorded in reputation_processed_messages. The unique
+// index includes the source, so recording a message under one source does
+// not make the insert for another source a no-op; a second credit for the
+// same giver/receiver pair is still subject to withinGiveWindow.
+const (
+	DetectionSourceGiveRep = "giverep"
+	DetectionSourceThanks  = "thanks"
+)
+
+// recordDetection inserts a row marking (guildID, messageID, source) as
+// processed, returning inserted=false if it already existed. Reprocessing a
+// channel can then only credit rep once per message per detection source.
+// messageTs is the
+// message's own timestamp (not when this row is inserted) - see
+// withinGiveWindow for why that distinction matters.
+func recordDetection(ctx context.Context, q querier, guildID, messageID, giverID, receiverID int64, source string, messageTs time.Time) (inserted bool, err error) {
+	res, err := q.ExecContext(ctx, `INSERT INTO reputation_processed_messages
+		(guild_id, message_id, giver_id, receiver_id, source, message_ts)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (guild_id, message_id, source) DO NOTHING`,
+		guildID, messageID, giverID, receiverID, source, messageTs)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// withinGiveWindow reports whether giverID already gave receiverID rep
+// within cooldown of msgTs, mirroring the cooldown real-time detection
+// enforces via conf.Cooldown, so a retroactive scan can't award a burst of
+// rep for the same pair that live detection would have throttled.
+//
+// This compares against the prior detection's message_ts, not when its row
+// was inserted: a retroactive scan inserts every row for a channel within
+// seconds of each other regardless of how far apart the messages actually
+// were, so comparing insertion time would collapse years of real history
+// into a single credit after the first one landed. The window is checked in
+// both directions because a backward scan (newest channel history first)
+// records a pair's later message before its earlier one.
+func withinGiveWindow(ctx context.Context, q querier, guildID, giverID, receiverID int64, msgTs time.Time, cooldown time.Duration) (bool, error) {
+	if cooldown <= 0 {
+		return false, nil
+	}
+
+	var exists bool
+	row := q.QueryRowContext(ctx, `SELECT EXISTS(
+		SELECT 1 FROM reputation_processed_messages
+		WHERE guild_id = $1 AND giver_id = $2 AND receiver_id = $3
+			AND message_ts > $4 AND message_ts < $5
+	)`, guildID, giverID, receiverID, msgTs.Add(-cooldown), msgTs.Add(cooldown))
+	if err := row.Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// creditDetection applies the live give-window cooldown and idempotent
+// insert-or-ignore detection a retroactive scan needs to stay safely
+// re-runnable, then bumps repChanges only for a genuinely new detection.
+// The message author is always treated as the giver.
+func creditDetection(ctx context.Context, guildID int64, msg *discordgo.Message, receiverID int64, source string, conf *models.ReputationConfig, repChanges map[int64]int64) error {
+	cooldown := time.Duration(conf.Cooldown) * time.Second
+	return creditDetectionWeighted(ctx, guildID, msg, msg.Author.ID, receiverID, source, 1, cooldown, repChanges)
+}
+
+// creditDetectionWeighted is the general form behind creditDetection, used
+// directly by the configurable detection rules so each rule's Weight is
+// applied and the giver can be someone other than the message author (e.g.
+// whoever added a rep-worthy reaction).
+//
+// The cooldown check, the processed_messages insert, and the rep update all
+// happen under the same pg_advisory_xact_lock on (guildID, giverID,
+// receiverID) and the same transaction: with the bounded worker pool
+// reprocessing can have several goroutines racing different channels, two of
+// them can both see an empty give-window for the same pair before either has
+// inserted its row, and both credit rep for what should have been a single
+// throttled detection. Committing the insert and the rep update together
+// also means a crash or `-cancel` between the two can never leave a
+// detection durably recorded without its score applied, which is what makes
+// ResumeIncompleteReprocessJobs actually safe to resume from.
+func creditDetectionWeighted(ctx context.Context, guildID int64, msg *discordgo.Message, giverID, receiverID int64, source string, weight int, cooldown time.Duration, repChanges map[int64]int64) error {
+	msgTs, err := msg.Timestamp.Parse()
+	if err != nil {
+		return err
+	}
+
+	tx, err := common.PQ.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lockKey := fmt.Sprintf("reputation-give:%d:%d:%d", guildID, giverID, receiverID)
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, lockKey); err != nil {
+		return err
+	}
+
+	inWindow, err := withinGiveWindow(ctx, tx, guildID, giverID, receiverID, msgTs, cooldown)
+	if err != nil {
+		return err
+	}
+	if inWindow {
+		return tx.Commit()
+	}
+
+	inserted, err := recordDetection(ctx, tx, guildID, msg.ID, giverID, receiverID, source, msgTs)
+	if err != nil {
+		return err
+	}
+	if !inserted {
+		return tx.Commit()
+	}
+
+	// Apply the rep delta here, inside the same transaction as the
+	// processed_messages insert above, instead of only aggregating it into
+	// repChanges for runReprocessJob to apply once at the very end. Without
+	// this, a crash or `-cancel` between the insert and the end-of-job apply
+	// would leave every detection made so far durably recorded but never
+	// scored - and unrecoverable, since the unique index on
+	// (guild_id, message_id, source) stops a resumed or re-run scan from
+	// ever re-crediting them.
+	if _, err := insertUpdateUserRep(ctx, tx, guildID, receiverID, int64(weight)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	repChanges[receiverID] += int64(weight)
+	return nil
+}
@@ -2,12 +2,15 @@ package reputation
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"sync"
 	"time"
 
+	"github.com/botlabs-gg/yagpdb/v2/bot"
 	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/common/ratelimit"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
 	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
 	"github.com/botlabs-gg/yagpdb/v2/reputation/models"
@@ -54,10 +57,35 @@ func sendErrorMessage(channelID int64, errorMsg string) {
 	}
 }
 
+// reprocessMessages starts a brand new reprocess job for the guild. Use
+// resumeReprocessJob instead to continue a job that's already in progress.
 func reprocessMessages(ctx context.Context, gs *dstate.GuildSet, conf *models.ReputationConfig, channelID int64) (*reprocessStats, error) {
+	job, err := createReprocessJob(ctx, gs.ID, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	return runReprocessJob(ctx, gs, conf, channelID, job)
+}
+
+// resumeReprocessJob continues a job found with done=false, picking up each
+// channel from its last saved cursor instead of rescanning from the top.
+func resumeReprocessJob(ctx context.Context, gs *dstate.GuildSet, conf *models.ReputationConfig, job *ReprocessJob) (*reprocessStats, error) {
+	return runReprocessJob(ctx, gs, conf, job.TriggerChannelID, job)
+}
+
+func runReprocessJob(ctx context.Context, gs *dstate.GuildSet, conf *models.ReputationConfig, channelID int64, job *ReprocessJob) (*reprocessStats, error) {
 	stats := &reprocessStats{}
 	fiveYearsAgo := time.Now().AddDate(-5, 0, 0)
 
+	// Wrap ctx so cancelReprocessJob can stop this job immediately if it's
+	// running in this process, without waiting for processChannel's next DB
+	// poll (see isJobCancelled, used for jobs running on another shard).
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	unregister := registerRunningJob(job.ID, cancel)
+	defer unregister()
+
 	// Track reputation changes per user
 	repChanges := make(map[int64]int64)
 
@@ -71,81 +99,123 @@ func reprocessMessages(ctx context.Context, gs *dstate.GuildSet, conf *models.Re
 	}()
 
 	// Get all text channels
-	channels := gs.Channels
-
-	channelErrors := 0 // Track failed channels
-
-	for _, channel := range channels {
+	var textChannels []*dstate.ChannelState
+	for _, channel := range gs.Channels {
 		// 0 = GUILD_TEXT channel type
-		if channel.Type != discordgo.ChannelTypeGuildText {
-			continue
+		if channel.Type == discordgo.ChannelTypeGuildText {
+			textChannels = append(textChannels, channel)
 		}
+	}
 
-		// Process channel messages
-		processed, changes, err := processChannel(ctx, channel.ID, fiveYearsAgo, conf)
-		if err != nil {
+	channelErrors := 0 // Track failed channels
+
+	// Scan channels through a bounded worker pool; results are drained here
+	// one at a time, so repChanges needs no locking of its own even though
+	// many channels are being walked concurrently (stats keeps its mutex for
+	// sendPeriodicUpdates, which reads it from another goroutine).
+	for res := range scanChannelsConcurrently(ctx, job.ID, gs.ID, textChannels, fiveYearsAgo, conf) {
+		if res.err != nil {
+			if errors.Is(res.err, context.Canceled) {
+				// Expected: either ctx was cancelled or isJobCancelled saw the
+				// `-cancel` flag mid-channel. Not a real error, so don't spam
+				// the channel with an error message for it.
+				continue
+			}
 			channelErrors++
-			errorMsg := fmt.Sprintf("Error processing channel <#%d>: %v", channel.ID, err)
-			logger.WithError(err).Errorf("Error processing channel %d", channel.ID)
+			errorMsg := fmt.Sprintf("Error processing channel <#%d>: %v", res.channelID, res.err)
+			logger.WithError(res.err).Errorf("Error processing channel %d", res.channelID)
 			sendErrorMessage(channelID, errorMsg) // Send error to Discord
 			continue
 		}
 
 		// Update stats
 		repCount := 0
-		for _, amount := range changes {
+		for _, amount := range res.changes {
 			repCount += int(amount)
 		}
-		stats.Add(processed, repCount)
+		stats.Add(res.processed, repCount)
 
 		// Aggregate reputation changes
-		for userID, amount := range changes {
+		for userID, amount := range res.changes {
 			repChanges[userID] += amount
 		}
-
-		// Rate limiting between channels
-		time.Sleep(1000 * time.Millisecond)
 	}
 
-	// Stop progress updater
+	// Stop progress updater. This must happen unconditionally - including on
+	// cancellation - or sendPeriodicUpdates leaks for the life of the bot.
 	close(stopChan)
 	wg.Wait()
 
-	// Apply reputation changes to database
-	uniqueUsers := 0
-	userErrors := 0 // Track failed user updates
-
-	for userID, amount := range repChanges {
-		if amount == 0 {
-			continue
-		}
-
-		uniqueUsers++
+	if ctx.Err() != nil {
+		return stats, ctx.Err()
+	}
+	// ctx itself is only cancelled same-process (see registerRunningJob);
+	// a job cancelled from another shard is only visible via the DB flag,
+	// so check that too before committing results and marking it done.
+	if cancelled, err := isJobCancelled(ctx, job.ID); err != nil {
+		logger.WithError(err).Errorf("Failed to check cancellation state for reprocess job %d", job.ID)
+	} else if cancelled {
+		return stats, context.Canceled
+	}
 
-		// Use the existing insertUpdateUserRep function
-		_, err := insertUpdateUserRep(ctx, gs.ID, userID, amount)
-		if err != nil {
-			userErrors++
-			errorMsg := fmt.Sprintf("Failed to update reputation for user <@%d>: %v", userID, err)
-			logger.WithError(err).Errorf("Failed to update rep for user %d", userID)
-			sendErrorMessage(channelID, errorMsg) // Send error to Discord
-			continue
+	// repChanges is only used for the summary below now - every change in it
+	// was already applied to the user's rep total inside creditDetectionWeighted,
+	// in the same transaction as the processed_messages row that makes the
+	// detection it came from un-repeatable. That's what lets a crash or
+	// `-cancel` partway through a scan be resumed safely: nothing here can
+	// still be pending.
+	uniqueUsers := 0
+	for _, amount := range repChanges {
+		if amount != 0 {
+			uniqueUsers++
 		}
 	}
-
 	stats.SetUsers(uniqueUsers)
 
 	// Send summary if there were errors
-	if channelErrors > 0 || userErrors > 0 {
+	if channelErrors > 0 {
 		summaryMsg := fmt.Sprintf("⚠️ **Reprocessing completed with errors:**\n"+
-			"- **Channel errors:** %d\n"+
-			"- **User update errors:** %d", channelErrors, userErrors)
+			"- **Channel errors:** %d", channelErrors)
 		sendErrorMessage(channelID, summaryMsg)
 	}
 
+	if err := markReprocessJobDone(ctx, job.ID); err != nil {
+		logger.WithError(err).Errorf("Failed to mark reprocess job %d done", job.ID)
+	}
+
 	return stats, nil
 }
 
+// ResumeIncompleteReprocessJobs finds every reprocess job left with done=false
+// (e.g. from a bot restart mid-scan) and continues it from its stored
+// cursors. Intended to be called once from the bot's ready/started hook.
+func ResumeIncompleteReprocessJobs(ctx context.Context) {
+	jobs, err := allIncompleteReprocessJobs(ctx)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list incomplete reputation reprocess jobs")
+		return
+	}
+
+	for _, job := range jobs {
+		gs := bot.State.GetGuild(job.GuildID)
+		if gs == nil {
+			continue
+		}
+
+		conf, err := GetConfig(ctx, job.GuildID)
+		if err != nil {
+			logger.WithError(err).Errorf("Failed to load reputation config for guild %d, skipping resumed job %d", job.GuildID, job.ID)
+			continue
+		}
+
+		go func(job *ReprocessJob) {
+			if _, err := resumeReprocessJob(ctx, gs, conf, job); err != nil {
+				logger.WithError(err).Errorf("Failed to resume reprocess job %d", job.ID)
+			}
+		}(job)
+	}
+}
+
 func sendPeriodicUpdates(channelID int64, stats *reprocessStats, stopChan chan struct{}) {
 	// Define update intervals: duration and count at each level
 	type updateInterval struct {
@@ -227,11 +297,21 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%ds", s)
 }
 
-func processChannel(ctx context.Context, channelID int64, since time.Time, conf *models.ReputationConfig) (int, map[int64]int64, error) {
+func processChannel(ctx context.Context, jobID, guildID, channelID int64, since time.Time, conf *models.ReputationConfig) (int, map[int64]int64, error) {
 	processed := 0
 	repChanges := make(map[int64]int64)
 
-	var beforeID int64 = 0
+	cursor, err := getOrCreateCursor(ctx, jobID, channelID)
+	if err != nil {
+		return processed, repChanges, err
+	}
+	if cursor.Done {
+		// Already finished on a previous run of this job - nothing to do.
+		return processed, repChanges, nil
+	}
+
+	beforeID := cursor.LastBeforeID
+	rules := compiledRulesFor(guildID, conf)
 
 	for {
 		select {
@@ -240,17 +320,20 @@ func processChannel(ctx context.Context, channelID int64, since time.Time, conf
 		default:
 		}
 
-		// Fetch messages (100 is Discord's limit)
-		// Try int64 first, fall back to string if needed
-		var messages []*discordgo.Message
-		var err error
-
-		if beforeID == 0 {
-			messages, err = common.BotSession.ChannelMessages(channelID, 100, 0, 0, 0)
-		} else {
-			messages, err = common.BotSession.ChannelMessages(channelID, 100, beforeID, 0, 0)
+		// Also poll the cancelled flag directly: if this job is running on a
+		// different shard process than the one that handled `-cancel`, ctx
+		// itself was never wired up to that cancellation, so this is the
+		// only thing that stops the scan promptly.
+		if cancelled, err := isJobCancelled(ctx, jobID); err != nil {
+			logger.WithError(err).Errorf("Failed to check cancellation state for reprocess job %d", jobID)
+		} else if cancelled {
+			return processed, repChanges, context.Canceled
 		}
 
+		// Fetch messages (100 is Discord's limit) through the shared
+		// rate-limit-aware fetcher, which blocks on the channel's bucket
+		// instead of sleeping a fixed amount between every batch.
+		messages, err := ratelimit.Default.ChannelMessages(ctx, common.BotSession, channelID, 100, beforeID, 0, 0)
 		if err != nil {
 			return processed, repChanges, err
 		}
@@ -268,6 +351,9 @@ func processChannel(ctx context.Context, channelID int64, since time.Time, conf
 
 			// Stop if message is older than 5 years
 			if msgTime.Before(since) {
+				if err := markCursorDone(ctx, jobID, channelID); err != nil {
+					logger.WithError(err).Errorf("Failed to mark reprocess cursor done for channel %d", channelID)
+				}
 				return processed, repChanges, nil
 			}
 
@@ -282,7 +368,9 @@ func processChannel(ctx context.Context, channelID int64, since time.Time, conf
 			if matches := giveRepPattern.FindStringSubmatch(msg.Content); matches != nil {
 				userID := common.MustParseInt(matches[1])
 				if userID != 0 && userID != msg.Author.ID {
-					repChanges[userID]++
+					if err := creditDetection(ctx, guildID, msg, userID, DetectionSourceGiveRep, conf, repChanges); err != nil {
+						logger.WithError(err).Errorf("Failed to record rep detection for message %d", msg.ID)
+					}
 				}
 				continue
 			}
@@ -292,17 +380,36 @@ func processChannel(ctx context.Context, channelID int64, since time.Time, conf
 				if matches := thanksPattern.FindStringSubmatch(msg.Content); matches != nil {
 					userID := common.MustParseInt(matches[1])
 					if userID != 0 && userID != msg.Author.ID {
-						repChanges[userID]++
+						if err := creditDetection(ctx, guildID, msg, userID, DetectionSourceThanks, conf, repChanges); err != nil {
+							logger.WithError(err).Errorf("Failed to record rep detection for message %d", msg.ID)
+						}
 					}
 				}
 			}
+
+			// Per-guild configurable rules: extra regexes/keywords (e.g.
+			// localized thanks words or another bot's syntax) and reactions.
+			if err := applyTextRules(ctx, guildID, msg, rules, conf, repChanges); err != nil {
+				logger.WithError(err).Errorf("Failed to apply rep detection rules for message %d", msg.ID)
+			}
+			if err := applyReactionRules(ctx, guildID, channelID, msg, rules, conf, repChanges); err != nil {
+				logger.WithError(err).Errorf("Failed to apply rep reaction rules for message %d", msg.ID)
+			}
 		}
 
 		// Set beforeID to oldest message in batch for next iteration
 		beforeID = messages[len(messages)-1].ID
+		oldestTsSeen, _ := messages[len(messages)-1].Timestamp.Parse()
+
+		// Checkpoint progress after every batch so a crash or a later
+		// channel error can't lose work already done in this channel.
+		if err := saveCursor(ctx, jobID, channelID, beforeID, oldestTsSeen); err != nil {
+			logger.WithError(err).Errorf("Failed to save reprocess cursor for channel %d", channelID)
+		}
+	}
 
-		// Rate limiting - INCREASED to 1 second between message batches
-		time.Sleep(1000 * time.Millisecond)
+	if err := markCursorDone(ctx, jobID, channelID); err != nil {
+		logger.WithError(err).Errorf("Failed to mark reprocess cursor done for channel %d", channelID)
 	}
 
 	return processed, repChanges, nil
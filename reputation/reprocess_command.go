@@ -0,0 +1,112 @@
+package reputation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/botlabs-gg/yagpdb/v2/commands"
+	"github.com/botlabs-gg/yagpdb/v2/lib/dcmd"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+// Command_ReprocessRep triggers (and manages) a background scan of a guild's
+// message history to retroactively credit reputation. It's a long running
+// job under the hood (see reprocess.go), so -status/-resume/-cancel let
+// admins check on or control a job without starting a new one by accident.
+var Command_ReprocessRep = &commands.YAGCommand{
+	CmdCategory:          commands.CategoryTool,
+	Name:                 "ReprocessRep",
+	Aliases:              []string{"reprocessreputation"},
+	Description:          "Scans message history to retroactively credit reputation. Can take a long time on large servers.",
+	RequireDiscordPerms:  []int64{discordgo.PermissionManageServer},
+	Switches: []*dcmd.ArgDef{
+		{Name: "status", Help: "Show progress of the active reprocess job for this server"},
+		{Name: "resume", Help: "Resume the server's unfinished reprocess job instead of starting a new one"},
+		{Name: "cancel", Help: "Cancel the server's active reprocess job"},
+	},
+	RunFunc: func(data *dcmd.Data) (interface{}, error) {
+		ctx := data.Context()
+
+		if data.Switch("status").Value != nil {
+			job, err := activeReprocessJob(ctx, data.GuildData.GS.ID)
+			if err != nil {
+				return nil, err
+			}
+			if job == nil {
+				return "No reputation reprocess job is currently running for this server.", nil
+			}
+
+			cursors, err := incompleteCursors(ctx, job.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			remaining := 0
+			for _, c := range cursors {
+				if !c.Done {
+					remaining++
+				}
+			}
+			return fmt.Sprintf("Reprocess job #%d is running, started %s. %d channel(s) started but not yet finished.",
+				job.ID, job.CreatedAt.Format("2006-01-02 15:04 MST"), remaining), nil
+		}
+
+		if data.Switch("cancel").Value != nil {
+			job, err := activeReprocessJob(ctx, data.GuildData.GS.ID)
+			if err != nil {
+				return nil, err
+			}
+			if job == nil {
+				return "No reputation reprocess job is currently running for this server.", nil
+			}
+
+			if err := cancelReprocessJob(ctx, job.ID); err != nil {
+				return nil, err
+			}
+			return fmt.Sprintf("Cancelled reprocess job #%d.", job.ID), nil
+		}
+
+		conf, err := GetConfig(ctx, data.GuildData.GS.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if data.Switch("resume").Value != nil {
+			job, err := activeReprocessJob(ctx, data.GuildData.GS.ID)
+			if err != nil {
+				return nil, err
+			}
+			if job == nil {
+				return "No reputation reprocess job to resume for this server. Run `reprocessrep` without `-resume` to start a new one.", nil
+			}
+
+			// context.Background(), not ctx: this job outlives RunFunc by
+			// hours, and ctx is scoped to the command's own execution - using
+			// it here would kill the job the moment "Resuming..." is
+			// returned. Matches ResumeIncompleteReprocessJobs, which resumes
+			// the same jobs on bot restart.
+			go func() {
+				if _, err := resumeReprocessJob(context.Background(), data.GuildData.GS, conf, job); err != nil {
+					logger.WithError(err).Errorf("Failed to resume reprocess job %d", job.ID)
+				}
+			}()
+			return fmt.Sprintf("Resuming reprocess job #%d.", job.ID), nil
+		}
+
+		if job, err := activeReprocessJob(ctx, data.GuildData.GS.ID); err != nil {
+			return nil, err
+		} else if job != nil {
+			return fmt.Sprintf("A reprocess job (#%d) is already running for this server, use `-resume` or `-cancel`.", job.ID), nil
+		}
+
+		// See the -resume case above for why this is context.Background()
+		// rather than ctx.
+		go func() {
+			if _, err := reprocessMessages(context.Background(), data.GuildData.GS, conf, data.ChannelID); err != nil {
+				logger.WithError(err).Error("Reputation reprocessing failed")
+			}
+		}()
+
+		return "Started scanning message history for reputation, this can take a long time on large servers. Use `-status` to check on it.", nil
+	},
+}
@@ -0,0 +1,189 @@
+package reputation
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+// runningJobCancelFuncs lets cancelReprocessJob stop a job that's actively
+// running in this process immediately, instead of only taking effect the
+// next time `-status`/processChannel happens to poll the DB. Jobs running
+// on a different shard process still pick up the cancellation via the
+// `cancelled` column (see isJobCancelled), just not instantly.
+var runningJobCancelFuncs sync.Map // jobID int64 -> context.CancelFunc
+
+// ReprocessJob tracks the lifecycle of a single "reprocess reputation history"
+// run for a guild, so it can survive channel errors and bot restarts.
+type ReprocessJob struct {
+	ID               int64
+	GuildID          int64
+	TriggerChannelID int64
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Done             bool
+	Cancelled        bool
+}
+
+// ReprocessCursor tracks how far a job has walked a single channel, so
+// processChannel can resume from `LastBeforeID` instead of starting over.
+type ReprocessCursor struct {
+	JobID        int64
+	ChannelID    int64
+	LastBeforeID int64
+	OldestTsSeen *time.Time
+	Done         bool
+}
+
+// createReprocessJob inserts a new job row for the given guild and returns it.
+func createReprocessJob(ctx context.Context, guildID, triggerChannelID int64) (*ReprocessJob, error) {
+	job := &ReprocessJob{GuildID: guildID, TriggerChannelID: triggerChannelID}
+	row := common.PQ.QueryRowContext(ctx, `INSERT INTO reputation_reprocess_jobs
+		(guild_id, trigger_channel_id) VALUES ($1, $2)
+		RETURNING id, created_at, updated_at, done, cancelled`, guildID, triggerChannelID)
+
+	if err := row.Scan(&job.ID, &job.CreatedAt, &job.UpdatedAt, &job.Done, &job.Cancelled); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// activeReprocessJob returns the guild's in-progress job, if any.
+func activeReprocessJob(ctx context.Context, guildID int64) (*ReprocessJob, error) {
+	job := &ReprocessJob{}
+	row := common.PQ.QueryRowContext(ctx, `SELECT id, guild_id, trigger_channel_id, created_at, updated_at, done, cancelled
+		FROM reputation_reprocess_jobs WHERE guild_id = $1 AND done = FALSE AND cancelled = FALSE
+		ORDER BY created_at DESC LIMIT 1`, guildID)
+
+	err := row.Scan(&job.ID, &job.GuildID, &job.TriggerChannelID, &job.CreatedAt, &job.UpdatedAt, &job.Done, &job.Cancelled)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// allIncompleteReprocessJobs returns every job across all guilds that hasn't
+// finished or been cancelled, used by the startup resumer.
+func allIncompleteReprocessJobs(ctx context.Context) ([]*ReprocessJob, error) {
+	rows, err := common.PQ.QueryContext(ctx, `SELECT id, guild_id, trigger_channel_id, created_at, updated_at, done, cancelled
+		FROM reputation_reprocess_jobs WHERE done = FALSE AND cancelled = FALSE`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*ReprocessJob
+	for rows.Next() {
+		job := &ReprocessJob{}
+		if err := rows.Scan(&job.ID, &job.GuildID, &job.TriggerChannelID, &job.CreatedAt, &job.UpdatedAt, &job.Done, &job.Cancelled); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func markReprocessJobDone(ctx context.Context, jobID int64) error {
+	_, err := common.PQ.ExecContext(ctx, `UPDATE reputation_reprocess_jobs SET done = TRUE, updated_at = NOW() WHERE id = $1`, jobID)
+	return err
+}
+
+// cancelReprocessJob marks the job cancelled in the DB, which any shard
+// polling it via isJobCancelled will notice within a batch or two, and
+// additionally cancels it immediately if it happens to be running in this
+// process.
+func cancelReprocessJob(ctx context.Context, jobID int64) error {
+	_, err := common.PQ.ExecContext(ctx, `UPDATE reputation_reprocess_jobs SET cancelled = TRUE, updated_at = NOW() WHERE id = $1`, jobID)
+	if err != nil {
+		return err
+	}
+	if cancel, ok := runningJobCancelFuncs.Load(jobID); ok {
+		cancel.(context.CancelFunc)()
+	}
+	return nil
+}
+
+// isJobCancelled polls the DB for the cancelled flag. Runs once per batch in
+// processChannel so a job running on a different shard process than the one
+// that handled `-cancel` still stops promptly.
+func isJobCancelled(ctx context.Context, jobID int64) (bool, error) {
+	var cancelled bool
+	row := common.PQ.QueryRowContext(ctx, `SELECT cancelled FROM reputation_reprocess_jobs WHERE id = $1`, jobID)
+	if err := row.Scan(&cancelled); err != nil {
+		return false, err
+	}
+	return cancelled, nil
+}
+
+// registerRunningJob records the cancel func for a job actively running in
+// this process, and returns a function to deregister it once the job is
+// done. See runningJobCancelFuncs.
+func registerRunningJob(jobID int64, cancel context.CancelFunc) (unregister func()) {
+	runningJobCancelFuncs.Store(jobID, cancel)
+	return func() { runningJobCancelFuncs.Delete(jobID) }
+}
+
+// getOrCreateCursor returns the channel's cursor for the job, creating a
+// fresh one (starting from the newest message) if this is the first visit.
+func getOrCreateCursor(ctx context.Context, jobID, channelID int64) (*ReprocessCursor, error) {
+	cursor := &ReprocessCursor{}
+	row := common.PQ.QueryRowContext(ctx, `SELECT job_id, channel_id, last_before_id, oldest_ts_seen, done
+		FROM reputation_reprocess_cursors WHERE job_id = $1 AND channel_id = $2`, jobID, channelID)
+
+	err := row.Scan(&cursor.JobID, &cursor.ChannelID, &cursor.LastBeforeID, &cursor.OldestTsSeen, &cursor.Done)
+	if err == nil {
+		return cursor, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	cursor = &ReprocessCursor{JobID: jobID, ChannelID: channelID}
+	_, err = common.PQ.ExecContext(ctx, `INSERT INTO reputation_reprocess_cursors (job_id, channel_id)
+		VALUES ($1, $2) ON CONFLICT (job_id, channel_id) DO NOTHING`, jobID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// saveCursor persists progress after a single 100-message batch so a crash
+// mid-channel resumes from `beforeID` instead of rescanning the channel.
+func saveCursor(ctx context.Context, jobID, channelID, beforeID int64, oldestTsSeen time.Time) error {
+	_, err := common.PQ.ExecContext(ctx, `UPDATE reputation_reprocess_cursors
+		SET last_before_id = $3, oldest_ts_seen = $4, updated_at = NOW()
+		WHERE job_id = $1 AND channel_id = $2`, jobID, channelID, beforeID, oldestTsSeen)
+	return err
+}
+
+func markCursorDone(ctx context.Context, jobID, channelID int64) error {
+	_, err := common.PQ.ExecContext(ctx, `UPDATE reputation_reprocess_cursors
+		SET done = TRUE, updated_at = NOW() WHERE job_id = $1 AND channel_id = $2`, jobID, channelID)
+	return err
+}
+
+// incompleteCursors returns the cursors, keyed by channel ID, of the channels
+// a job has started but not finished walking yet. Used by -status.
+func incompleteCursors(ctx context.Context, jobID int64) (map[int64]*ReprocessCursor, error) {
+	rows, err := common.PQ.QueryContext(ctx, `SELECT job_id, channel_id, last_before_id, oldest_ts_seen, done
+		FROM reputation_reprocess_cursors WHERE job_id = $1 AND done = FALSE`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cursors := make(map[int64]*ReprocessCursor)
+	for rows.Next() {
+		c := &ReprocessCursor{}
+		if err := rows.Scan(&c.JobID, &c.ChannelID, &c.LastBeforeID, &c.OldestTsSeen, &c.Done); err != nil {
+			return nil, err
+		}
+		cursors[c.ChannelID] = c
+	}
+	return cursors, rows.Err()
+}
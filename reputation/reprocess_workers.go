@@ -0,0 +1,101 @@
+package reputation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+	"github.com/botlabs-gg/yagpdb/v2/reputation/models"
+)
+
+// maxReprocessWorkers caps how many channels a single job scans at once,
+// regardless of how many text channels the guild has. The shared token
+// bucket limiter (common/ratelimit) still caps total Discord request rate
+// across all of them.
+const maxReprocessWorkers = 8
+
+// channelResult is one worker's outcome for a single channel, handed back
+// to runReprocessJob over a channel so stats/repChanges only ever get
+// touched by the single goroutine that's already ranging over results.
+type channelResult struct {
+	channelID int64
+	processed int
+	changes   map[int64]int64
+	err       error
+}
+
+// numReprocessWorkers picks the worker pool size: never more than
+// maxReprocessWorkers, and no point starting more workers than channels.
+func numReprocessWorkers(numChannels int) int {
+	n := maxReprocessWorkers
+	if numChannels < n {
+		n = numChannels
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// channelWorkFunc does the actual per-channel work for scanChannelsConcurrently.
+// Production code always passes processChannel; tests pass a fake so the pool
+// itself - fan-out, bounded concurrency, cancellation - can be exercised
+// without a live DB or Discord session.
+type channelWorkFunc func(ctx context.Context, channelID int64) (processed int, changes map[int64]int64, err error)
+
+// scanChannelsConcurrently fans channel scanning out across a bounded worker
+// pool instead of walking channels one at a time, so a guild with many
+// channels doesn't wait on each in turn - the shared rate limiter still
+// caps how fast Discord is actually hit. ctx cancellation (e.g. from
+// `-cancel`) stops both feeding new work and draining results early.
+func scanChannelsConcurrently(ctx context.Context, jobID, guildID int64, channels []*dstate.ChannelState, since time.Time, conf *models.ReputationConfig) <-chan channelResult {
+	work := func(ctx context.Context, channelID int64) (int, map[int64]int64, error) {
+		return processChannel(ctx, jobID, guildID, channelID, since, conf)
+	}
+	return scanChannelsWith(ctx, channels, work)
+}
+
+// scanChannelsWith is scanChannelsConcurrently's pool implementation, taking
+// the per-channel work as a parameter so it can be benchmarked and tested
+// directly (see reprocess_workers_test.go) instead of only through its
+// production wiring.
+func scanChannelsWith(ctx context.Context, channels []*dstate.ChannelState, work channelWorkFunc) <-chan channelResult {
+	jobs := make(chan *dstate.ChannelState)
+	results := make(chan channelResult)
+
+	numWorkers := numReprocessWorkers(len(channels))
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for channel := range jobs {
+				processed, changes, err := work(ctx, channel.ID)
+				select {
+				case results <- channelResult{channelID: channel.ID, processed: processed, changes: changes, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, channel := range channels {
+			select {
+			case jobs <- channel:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
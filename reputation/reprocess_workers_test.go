@@ -0,0 +1,183 @@
+package reputation
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/lib/dstate"
+)
+
+// fakeChannels returns n synthetic text channels, numbered 1..n, for feeding
+// to scanChannelsWith without a live guild.
+func fakeChannels(n int) []*dstate.ChannelState {
+	channels := make([]*dstate.ChannelState, n)
+	for i := range channels {
+		channels[i] = &dstate.ChannelState{ID: int64(i + 1)}
+	}
+	return channels
+}
+
+// latencyWork simulates processChannel's dominant cost - one blocking
+// network round trip per channel - without touching the DB or Discord, so
+// scanChannelsWith's actual pooling can be driven directly.
+func latencyWork(latency time.Duration) channelWorkFunc {
+	return func(ctx context.Context, channelID int64) (int, map[int64]int64, error) {
+		time.Sleep(latency)
+		return 1, nil, nil
+	}
+}
+
+func drain(results <-chan channelResult) int {
+	n := 0
+	for range results {
+		n++
+	}
+	return n
+}
+
+// BenchmarkScanChannels_Serial and BenchmarkScanChannels_Pool run a
+// synthetic 100-channel guild with a fixed per-channel latency - the serial
+// case through a single goroutine that handles one channel at a time, the
+// pool case through scanChannelsWith with its default sizing - to
+// demonstrate the worker pool's wall-clock win over walking channels one at
+// a time. Real processChannel calls also compete for the shared rate
+// limiter, which this fake work doesn't model.
+const benchChannels = 100
+const benchLatency = 2 * time.Millisecond
+
+func BenchmarkScanChannels_Serial(b *testing.B) {
+	channels := fakeChannels(benchChannels)
+	work := latencyWork(benchLatency)
+	for i := 0; i < b.N; i++ {
+		jobs := make(chan *dstate.ChannelState)
+		results := make(chan channelResult)
+		go func() {
+			defer close(results)
+			for channel := range jobs {
+				processed, changes, err := work(context.Background(), channel.ID)
+				results <- channelResult{channelID: channel.ID, processed: processed, changes: changes, err: err}
+			}
+		}()
+		go func() {
+			defer close(jobs)
+			for _, channel := range channels {
+				jobs <- channel
+			}
+		}()
+		drain(results)
+	}
+}
+
+func BenchmarkScanChannels_Pool(b *testing.B) {
+	channels := fakeChannels(benchChannels)
+	work := latencyWork(benchLatency)
+	for i := 0; i < b.N; i++ {
+		drain(scanChannelsWith(context.Background(), channels, work))
+	}
+}
+
+func TestNumReprocessWorkers(t *testing.T) {
+	cases := []struct {
+		numChannels int
+		want        int
+	}{
+		{0, 1},
+		{1, 1},
+		{3, 3},
+		{8, 8},
+		{100, maxReprocessWorkers},
+	}
+
+	for _, c := range cases {
+		if got := numReprocessWorkers(c.numChannels); got != c.want {
+			t.Errorf("numReprocessWorkers(%d) = %d, want %d", c.numChannels, got, c.want)
+		}
+	}
+}
+
+// TestScanChannelsWith_Aggregates checks every channel is scanned exactly
+// once and its processed count comes through on the results channel,
+// regardless of how the bounded pool interleaves them.
+func TestScanChannelsWith_Aggregates(t *testing.T) {
+	channels := fakeChannels(20)
+	work := func(ctx context.Context, channelID int64) (int, map[int64]int64, error) {
+		return 1, map[int64]int64{channelID: 1}, nil
+	}
+
+	seen := make(map[int64]bool)
+	totalProcessed := 0
+	for res := range scanChannelsWith(context.Background(), channels, work) {
+		if res.err != nil {
+			t.Fatalf("channel %d: unexpected error: %v", res.channelID, res.err)
+		}
+		if seen[res.channelID] {
+			t.Fatalf("channel %d scanned more than once", res.channelID)
+		}
+		seen[res.channelID] = true
+		totalProcessed += res.processed
+	}
+
+	if len(seen) != len(channels) {
+		t.Fatalf("got %d distinct channel results, want %d", len(seen), len(channels))
+	}
+	if totalProcessed != len(channels) {
+		t.Fatalf("got %d total processed, want %d", totalProcessed, len(channels))
+	}
+}
+
+// TestScanChannelsWith_BoundsConcurrency asserts the pool never runs more
+// than numReprocessWorkers channels' work at once.
+func TestScanChannelsWith_BoundsConcurrency(t *testing.T) {
+	channels := fakeChannels(50)
+	var inFlight, maxInFlight atomic.Int64
+
+	work := func(ctx context.Context, channelID int64) (int, map[int64]int64, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return 1, nil, nil
+	}
+
+	drain(scanChannelsWith(context.Background(), channels, work))
+
+	want := int64(numReprocessWorkers(len(channels)))
+	if got := maxInFlight.Load(); got > want {
+		t.Errorf("max concurrent channel workers = %d, want <= %d", got, want)
+	}
+}
+
+// TestScanChannelsWith_CancelStopsEarly asserts that cancelling ctx stops
+// the pool from running every channel through work, instead of the
+// cancellation only being noticed after the whole scan has already run.
+func TestScanChannelsWith_CancelStopsEarly(t *testing.T) {
+	channels := fakeChannels(50)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var started atomic.Int64
+	release := make(chan struct{})
+	work := func(ctx context.Context, channelID int64) (int, map[int64]int64, error) {
+		started.Add(1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return 1, nil, ctx.Err()
+	}
+
+	results := scanChannelsWith(ctx, channels, work)
+	cancel()
+	close(release)
+	drain(results)
+
+	if got := started.Load(); got >= int64(len(channels)) {
+		t.Errorf("started work for all %d channels despite cancellation (started %d)", len(channels), got)
+	}
+}
@@ -0,0 +1,83 @@
+package reputation
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/reputation/models"
+	"github.com/botlabs-gg/yagpdb/v2/web"
+	goji "goji.io"
+	"goji.io/pat"
+)
+
+//go:embed assets/reputation-rules.html
+var webAssets embed.FS
+
+// InitWeb registers the reputation control panel's detection rules page -
+// the admin-facing counterpart to the DetectionRules/ConfigVersion config
+// added in detection_rules.go - so guild admins have somewhere to add a
+// regex, reaction emoji or localized thanks word without writing SQL.
+func (p *Plugin) InitWeb() {
+	tmpl, err := webAssets.ReadFile("assets/reputation-rules.html")
+	if err != nil {
+		panic(err)
+	}
+	web.AddHTMLTemplate("reputation/assets/reputation-rules.html", string(tmpl))
+	web.AddSidebarItem(common.PluginCategoryFun, &web.SidebarItem{
+		Name: "Reputation",
+		URL:  "reputation",
+	})
+
+	getHandler := web.ControllerHandler(HandleGetDetectionRules, "cp_reputation_rules")
+
+	subMux := goji.SubMux()
+	web.CPMux.Handle(pat.New("/reputation/*"), subMux)
+	subMux.Use(web.RequireBotMemberMW)
+	subMux.Use(web.RequireGuildChannelsMiddleware)
+	subMux.Use(web.RequirePermMW(discordgo.PermissionManageServer))
+
+	subMux.Handle(pat.Get("/"), getHandler)
+	subMux.Handle(pat.Get(""), getHandler)
+	subMux.Handle(pat.Post("/rules"), web.ControllerPostHandler(HandleSaveDetectionRules, getHandler, nil))
+}
+
+// HandleGetDetectionRules renders the guild's current detection rules into
+// the control panel page, so HandleSaveDetectionRules has something to edit.
+func HandleGetDetectionRules(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx := r.Context()
+	activeGuild, tmpl := web.GetBaseCPContextData(ctx)
+
+	conf, err := GetConfig(ctx, activeGuild.ID)
+	if err != nil {
+		return tmpl, err
+	}
+
+	return tmpl.Set("DetectionRules", conf.DetectionRules), nil
+}
+
+// HandleSaveDetectionRules validates and persists a guild's custom
+// reputation detection rules (models.DetectionRules), posted as a JSON
+// array from the rule editor on the control panel page registered in
+// InitWeb.
+func HandleSaveDetectionRules(w http.ResponseWriter, r *http.Request) (web.TemplateData, error) {
+	ctx := r.Context()
+	activeGuild, tmpl := web.GetBaseCPContextData(ctx)
+
+	var rules models.DetectionRules
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		return tmpl, web.NewPublicError("Invalid detection rules: " + err.Error())
+	}
+
+	if err := ValidateDetectionRules(rules); err != nil {
+		return tmpl, web.NewPublicError(err.Error())
+	}
+
+	if err := SaveDetectionRules(ctx, activeGuild.ID, rules); err != nil {
+		return tmpl, err
+	}
+
+	return tmpl, nil
+}
@@ -0,0 +1,22 @@
+package salesforcestatus
+
+import "context"
+
+// Subscribe adds (or repoints) this channel's subscription to instance's
+// status updates for the guild. Used by stdcommands/sfstatus.go's
+// `subscribe` subcommand.
+func Subscribe(ctx context.Context, guildID, channelID int64, instance string) error {
+	return addSubscription(ctx, guildID, channelID, instance)
+}
+
+// Unsubscribe removes the guild's subscription to instance, if any. Used by
+// stdcommands/sfstatus.go's `unsubscribe` subcommand.
+func Unsubscribe(ctx context.Context, guildID int64, instance string) error {
+	return removeSubscription(ctx, guildID, instance)
+}
+
+// ListSubscriptions returns every instance the guild is currently
+// subscribed to. Used by stdcommands/sfstatus.go's `list` subcommand.
+func ListSubscriptions(ctx context.Context, guildID int64) ([]*Subscription, error) {
+	return guildSubscriptions(ctx, guildID)
+}
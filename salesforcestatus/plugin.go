@@ -0,0 +1,60 @@
+// Package salesforcestatus lets a guild subscribe a channel to one or more
+// Salesforce instances and get notified when their status changes, backing
+// the `sfstatus subscribe`/`unsubscribe`/`list` subcommands (see
+// stdcommands/sfstatus.go) with persistence and a background poller.
+package salesforcestatus
+
+import (
+	"context"
+	"sync"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+// defaultPollInterval is how often subscribed instances are re-checked when
+// no interval is configured.
+const defaultPollInterval = 2 * 60 // seconds
+
+var logger = common.GetPluginLogger(&Plugin{})
+
+type Plugin struct {
+	stop      context.CancelFunc
+	stoppedWG sync.WaitGroup
+}
+
+func RegisterPlugin() {
+	p := &Plugin{}
+	common.RegisterPlugin(p)
+}
+
+func (p *Plugin) PluginInfo() *common.PluginInfo {
+	return &common.PluginInfo{
+		Name:     "Salesforce Status",
+		SysName:  "salesforcestatus",
+		Category: common.PluginCategoryMisc,
+	}
+}
+
+// BotInit starts the background poller for all subscribed instances. It's
+// called once the bot session (common.BotSession) is ready to send
+// messages.
+func (p *Plugin) BotInit() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.stop = cancel
+
+	p.stoppedWG.Add(1)
+	go func() {
+		defer p.stoppedWG.Done()
+		runPoller(ctx)
+	}()
+}
+
+// StopBot signals the poller to stop and waits for it to exit, so a bot
+// restart doesn't leave a stray goroutine hitting status.salesforce.com.
+func (p *Plugin) StopBot(wg *sync.WaitGroup) {
+	defer wg.Done()
+	if p.stop != nil {
+		p.stop()
+	}
+	p.stoppedWG.Wait()
+}
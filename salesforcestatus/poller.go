@@ -0,0 +1,308 @@
+package salesforcestatus
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+)
+
+// PollInterval is how often subscribed instances are re-checked. It defaults
+// to defaultPollInterval but can be set (before RegisterPlugin's BotInit
+// runs, e.g. from an operator's own startup config) to poll more or less
+// aggressively, and overridden in tests.
+var PollInterval = defaultPollInterval * time.Second
+
+// requestTimeout bounds a single status.salesforce.com request. Without it,
+// a wedged TCP connection to one instance hangs getJSON forever - and since
+// pollOnce walks subscriptions serially, that stalls monitoring for every
+// other guild and instance too, not just the slow one.
+const requestTimeout = 10 * time.Second
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+type instanceStatus struct {
+	Key             string `json:"key"`
+	Status          string `json:"status"`
+	GeneralMessages []struct {
+		Subject string `json:"subject"`
+		Body    string `json:"body"`
+	} `json:"GeneralMessages"`
+}
+
+type instanceIncident struct {
+	ID     string `json:"id"`
+	Active bool   `json:"active"`
+	Title  string `json:"message"`
+}
+
+// runPoller re-checks every subscription on a ticker until ctx is cancelled,
+// which happens on bot shutdown (see Plugin.StopBot).
+func runPoller(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	pollOnce(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			pollOnce(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func pollOnce(ctx context.Context) {
+	subs, err := allSubscriptions(ctx)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list salesforce status subscriptions")
+		return
+	}
+
+	for _, sub := range subs {
+		if err := pollSubscription(ctx, sub); err != nil {
+			logger.WithError(err).Errorf("Failed to poll salesforce instance %s for guild %d", sub.Instance, sub.GuildID)
+		}
+	}
+}
+
+func pollSubscription(ctx context.Context, sub *Subscription) error {
+	status, statusETag, notModified, err := fetchStatus(ctx, sub.Instance, sub.StatusETag)
+	if err != nil {
+		return err
+	}
+
+	var statusChanged, messagesChanged bool
+	if !notModified {
+		messageHash := hashGeneralMessages(status.GeneralMessages)
+		statusChanged = status.Status != sub.LastStatus
+		messagesChanged = messageHash != sub.LastMessageHash
+
+		if statusChanged || messagesChanged {
+			if err := common.BotSession.ChannelMessageSendEmbed(sub.ChannelID, statusEmbed(sub.Instance, status, statusChanged)); err != nil {
+				logger.WithError(err).Errorf("Failed to post salesforce status update to channel %d", sub.ChannelID)
+			}
+		}
+
+		sub.LastStatus = status.Status
+		sub.LastMessageHash = messageHash
+		sub.StatusETag = statusETag
+	}
+
+	incidents, incidentsETag, incidentsNotModified, err := fetchIncidents(ctx, sub.Instance, sub.IncidentsETag)
+	if err != nil {
+		return err
+	}
+
+	if !incidentsNotModified {
+		activeIDs := activeIncidentIDs(incidents)
+		opened, closed := diffIncidentIDs(decodeIncidentIDs(sub.LastActiveIncidentIDs), activeIDs)
+		if len(opened) > 0 || len(closed) > 0 {
+			if err := common.BotSession.ChannelMessageSendEmbed(sub.ChannelID, incidentEmbed(sub.Instance, incidents, opened, closed)); err != nil {
+				logger.WithError(err).Errorf("Failed to post salesforce incident update to channel %d", sub.ChannelID)
+			}
+		}
+		sub.LastActiveIncidentIDs = encodeIncidentIDs(activeIDs)
+		sub.IncidentsETag = incidentsETag
+	}
+
+	if notModified && incidentsNotModified {
+		return nil
+	}
+	return updateSubscriptionState(ctx, sub)
+}
+
+func fetchStatus(ctx context.Context, instance, etag string) (*instanceStatus, string, bool, error) {
+	url := fmt.Sprintf("https://status.salesforce.com/api/instances/%s/status", instance)
+	var status instanceStatus
+	newETag, notModified, err := getJSON(ctx, url, etag, &status)
+	return &status, newETag, notModified, err
+}
+
+func fetchIncidents(ctx context.Context, instance, etag string) ([]instanceIncident, string, bool, error) {
+	url := fmt.Sprintf("https://status.salesforce.com/api/instances/%s/incidents", instance)
+	var incidents []instanceIncident
+	newETag, notModified, err := getJSON(ctx, url, etag, &incidents)
+	return incidents, newETag, notModified, err
+}
+
+// getJSON performs a conditional GET, sending If-None-Match when an ETag
+// from a previous poll is known so an unchanged instance costs nothing but
+// the round trip.
+func getJSON(ctx context.Context, url, etag string, dst interface{}) (newETag string, notModified bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", false, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return etag, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("salesforce status API returned HTTP %d for %s", resp.StatusCode, url)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	if err := json.Unmarshal(body, dst); err != nil {
+		return "", false, err
+	}
+
+	return resp.Header.Get("ETag"), false, nil
+}
+
+func hashGeneralMessages(messages []struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}) string {
+	h := sha1.New()
+	for _, m := range messages {
+		io.WriteString(h, m.Subject)
+		io.WriteString(h, m.Body)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// activeIncidentIDs returns the sorted IDs of every currently-active
+// incident, so pollSubscription can diff this poll's set against the
+// previous one instead of trusting incidents[0] to be "the" incident and a
+// changed key to mean it closed - a feed that drops a resolved incident
+// outright, rather than flipping Active to false, never produces a changed
+// key there.
+func activeIncidentIDs(incidents []instanceIncident) []string {
+	var ids []string
+	for _, inc := range incidents {
+		if inc.Active {
+			ids = append(ids, inc.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func encodeIncidentIDs(ids []string) string {
+	return strings.Join(ids, ",")
+}
+
+func decodeIncidentIDs(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// diffIncidentIDs compares two sorted sets of active incident IDs, returning
+// the ones that newly appeared (opened) and the ones that dropped out
+// (closed) - whether because the incident resolved in place or because the
+// feed stopped listing it entirely.
+func diffIncidentIDs(prev, current []string) (opened, closed []string) {
+	currentSet := make(map[string]bool, len(current))
+	for _, id := range current {
+		currentSet[id] = true
+	}
+	prevSet := make(map[string]bool, len(prev))
+	for _, id := range prev {
+		prevSet[id] = true
+		if !currentSet[id] {
+			closed = append(closed, id)
+		}
+	}
+	for _, id := range current {
+		if !prevSet[id] {
+			opened = append(opened, id)
+		}
+	}
+	return opened, closed
+}
+
+func statusEmbed(instance string, status *instanceStatus, statusChanged bool) *discordgo.MessageEmbed {
+	title := fmt.Sprintf("Salesforce instance %s: %s", instance, status.Status)
+	if !statusChanged {
+		title = fmt.Sprintf("Salesforce instance %s update", instance)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: title,
+		Color: statusColor(status.Status),
+	}
+
+	if len(status.GeneralMessages) > 0 {
+		var sb strings.Builder
+		for i, m := range status.GeneralMessages {
+			if i >= 3 {
+				fmt.Fprintf(&sb, "\n...and %d more messages", len(status.GeneralMessages)-3)
+				break
+			}
+			fmt.Fprintf(&sb, "**%s**\n%s\n\n", m.Subject, m.Body)
+		}
+		embed.Description = sb.String()
+	}
+
+	return embed
+}
+
+// incidentEmbed reports every incident that newly opened or closed since the
+// last poll (see diffIncidentIDs). A closed ID that the feed dropped
+// entirely, rather than keeping around with Active=false, won't be in
+// incidents - it's still reported, just by ID instead of by title.
+func incidentEmbed(instance string, incidents []instanceIncident, opened, closed []string) *discordgo.MessageEmbed {
+	byID := make(map[string]instanceIncident, len(incidents))
+	for _, inc := range incidents {
+		byID[inc.ID] = inc
+	}
+
+	describe := func(id string) string {
+		if inc, ok := byID[id]; ok {
+			return inc.Title
+		}
+		return id
+	}
+
+	var sb strings.Builder
+	for _, id := range opened {
+		fmt.Fprintf(&sb, "**Opened:** %s\n", describe(id))
+	}
+	for _, id := range closed {
+		fmt.Fprintf(&sb, "**Closed:** %s\n", describe(id))
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Salesforce instance %s: incident update", instance),
+		Description: sb.String(),
+		Color:       statusColor(""),
+	}
+}
+
+func statusColor(status string) int {
+	switch status {
+	case "OK":
+		return 0x2ECC71
+	case "MAJOR_INCIDENT_CORE", "MAINTENANCE":
+		return 0xE74C3C
+	case "MINOR_INCIDENT_CORE", "PERFORMANCE_DEGRADATION":
+		return 0xF39C12
+	default:
+		return 0x95A5A6
+	}
+}
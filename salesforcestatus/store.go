@@ -0,0 +1,83 @@
+package salesforcestatus
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/botlabs-gg/yagpdb/v2/common"
+)
+
+// Subscription is one guild's channel-to-instance subscription, along with
+// the last-seen state used to detect transitions and the ETags used to
+// avoid re-fetching unchanged data.
+type Subscription struct {
+	GuildID   int64
+	ChannelID int64
+	Instance  string
+	// LastActiveIncidentIDs is the sorted, comma-joined set of incident IDs
+	// that were active as of the last poll (see activeIncidentIDs), so the
+	// next poll can diff the two sets instead of trusting the feed to keep
+	// closed incidents around with Active=false at index 0.
+	LastActiveIncidentIDs string
+	LastStatus            string
+	LastMessageHash       string
+	StatusETag            string
+	IncidentsETag         string
+}
+
+func addSubscription(ctx context.Context, guildID, channelID int64, instance string) error {
+	_, err := common.PQ.ExecContext(ctx, `INSERT INTO salesforce_status_subscriptions
+		(guild_id, channel_id, instance) VALUES ($1, $2, $3)
+		ON CONFLICT (guild_id, instance) DO UPDATE SET channel_id = $2, updated_at = NOW()`,
+		guildID, channelID, instance)
+	return err
+}
+
+func removeSubscription(ctx context.Context, guildID int64, instance string) error {
+	_, err := common.PQ.ExecContext(ctx, `DELETE FROM salesforce_status_subscriptions
+		WHERE guild_id = $1 AND instance = $2`, guildID, instance)
+	return err
+}
+
+func guildSubscriptions(ctx context.Context, guildID int64) ([]*Subscription, error) {
+	rows, err := common.PQ.QueryContext(ctx, `SELECT guild_id, channel_id, instance, last_status, last_active_incident_ids, last_message_hash, status_etag, incidents_etag
+		FROM salesforce_status_subscriptions WHERE guild_id = $1 ORDER BY instance`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSubscriptions(rows)
+}
+
+func allSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	rows, err := common.PQ.QueryContext(ctx, `SELECT guild_id, channel_id, instance, last_status, last_active_incident_ids, last_message_hash, status_etag, incidents_etag
+		FROM salesforce_status_subscriptions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSubscriptions(rows)
+}
+
+func scanSubscriptions(rows *sql.Rows) ([]*Subscription, error) {
+	var subs []*Subscription
+	for rows.Next() {
+		s := &Subscription{}
+		if err := rows.Scan(&s.GuildID, &s.ChannelID, &s.Instance, &s.LastStatus, &s.LastActiveIncidentIDs, &s.LastMessageHash, &s.StatusETag, &s.IncidentsETag); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// updateSubscriptionState persists the status/incident/ETag values observed
+// by the most recent poll, so the next poll can both detect a transition
+// and send `If-None-Match` to skip the work entirely if nothing changed.
+func updateSubscriptionState(ctx context.Context, s *Subscription) error {
+	_, err := common.PQ.ExecContext(ctx, `UPDATE salesforce_status_subscriptions
+		SET last_status = $3, last_active_incident_ids = $4, last_message_hash = $5, status_etag = $6, incidents_etag = $7, updated_at = NOW()
+		WHERE guild_id = $1 AND instance = $2`,
+		s.GuildID, s.Instance, s.LastStatus, s.LastActiveIncidentIDs, s.LastMessageHash, s.StatusETag, s.IncidentsETag)
+	return err
+}
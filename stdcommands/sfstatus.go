@@ -10,6 +10,7 @@ import (
 	"github.com/botlabs-gg/yagpdb/v2/commands"
 	"github.com/botlabs-gg/yagpdb/v2/lib/dcmd"
 	"github.com/botlabs-gg/yagpdb/v2/lib/discordgo"
+	"github.com/botlabs-gg/yagpdb/v2/salesforcestatus"
 )
 
 // SalesforceStatus represents the JSON response structure
@@ -29,12 +30,22 @@ type SalesforceStatus struct {
 var Command_sfstatus = &commands.YAGCommand{
 	CmdCategory:  commands.CategoryTool,
 	Name:         "sfstatus",
-	Description:  "Checks Salesforce instance status",
+	Description:  "Checks Salesforce instance status. `subscribe <instance>` notifies this channel of status changes instead of a one-off lookup; `unsubscribe <instance>` and `list` manage the server's subscriptions.",
 	RequiredArgs: 1,
 	Arguments: []*dcmd.ArgDef{
 		{Name: "Instance", Type: dcmd.String},
+		{Name: "SubscribeInstance", Type: dcmd.String, Default: ""},
 	},
 	RunFunc: func(data *dcmd.Data) (interface{}, error) {
+		switch strings.ToLower(data.Args[0].Str()) {
+		case "subscribe":
+			return runSfStatusSubscribe(data)
+		case "unsubscribe":
+			return runSfStatusUnsubscribe(data)
+		case "list":
+			return runSfStatusList(data)
+		}
+
 		instance := strings.ToUpper(data.Args[0].Str())
 
 		// Fetch status from Salesforce API
@@ -141,3 +152,65 @@ func truncateString(s string, maxLen int) string {
 	return s[:maxLen] + "..."
 }
 
+// requireManageServer gates the subscribe/unsubscribe/list subcommands,
+// unlike the plain `sfstatus <instance>` lookup above which anyone can run.
+func requireManageServer(data *dcmd.Data) bool {
+	return data.GuildData.MS.Permissions&discordgo.PermissionManageServer != 0
+}
+
+func runSfStatusSubscribe(data *dcmd.Data) (interface{}, error) {
+	if !requireManageServer(data) {
+		return "You need the Manage Server permission to manage Salesforce status subscriptions.", nil
+	}
+
+	instance := strings.ToUpper(data.Args[1].Str())
+	if instance == "" {
+		return "You need to specify an instance, e.g. `sfstatus subscribe NA1`.", nil
+	}
+
+	if err := salesforcestatus.Subscribe(data.Context(), data.GuildData.GS.ID, data.ChannelID, instance); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("This channel will now be notified about status changes for instance **%s**.", instance), nil
+}
+
+func runSfStatusUnsubscribe(data *dcmd.Data) (interface{}, error) {
+	if !requireManageServer(data) {
+		return "You need the Manage Server permission to manage Salesforce status subscriptions.", nil
+	}
+
+	instance := strings.ToUpper(data.Args[1].Str())
+	if instance == "" {
+		return "You need to specify an instance, e.g. `sfstatus unsubscribe NA1`.", nil
+	}
+
+	if err := salesforcestatus.Unsubscribe(data.Context(), data.GuildData.GS.ID, instance); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Unsubscribed this server from instance **%s**.", instance), nil
+}
+
+func runSfStatusList(data *dcmd.Data) (interface{}, error) {
+	if !requireManageServer(data) {
+		return "You need the Manage Server permission to manage Salesforce status subscriptions.", nil
+	}
+
+	subs, err := salesforcestatus.ListSubscriptions(data.Context(), data.GuildData.GS.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(subs) == 0 {
+		return "This server isn't subscribed to any Salesforce instances.", nil
+	}
+
+	var sb strings.Builder
+	for _, s := range subs {
+		status := s.LastStatus
+		if status == "" {
+			status = "unknown"
+		}
+		fmt.Fprintf(&sb, "**%s** in <#%d> (last known status: %s)\n", s.Instance, s.ChannelID, status)
+	}
+	return sb.String(), nil
+}
+